@@ -9,7 +9,10 @@
 
 package syscall
 
-import "sync"
+import (
+	"encoding/binary"
+	"sync"
+)
 
 const (
 	AF_UNSPEC = iota
@@ -46,7 +49,7 @@ const (
 	SHUT_RDWR  = 0x2
 	SHUT_WR    = 0x1
 
-	SO_TYPE
+	SO_TYPE = iota
 	NET_RT_IFLIST
 	IFNAMSIZ
 	IFF_UP
@@ -154,65 +157,602 @@ func (sa *SockaddrDatalink) copy() Sockaddr {
 func (sa *SockaddrDatalink) key() interface{} { return *sa }
 
 func socket(proto, sotype, unused int) (fd int, err int)
+
+// CurrentBackend is consulted by every package-level socket call below.
+// It defaults to fakeBackend, the in-process simulated network; call
+// SetBackend to route through an rpcBackend instead and reach a real
+// network from a WASM binary.
+var CurrentBackend Backend = fakeBackend{}
+
+// SetBackend swaps the backend used for all subsequent socket calls.
+func SetBackend(b Backend) {
+	CurrentBackend = b
+}
+
+// Backend is the seam between the socket calls package net relies on
+// and whatever actually moves the bytes: fakeBackend keeps everything
+// in-process, rpcBackend ships the same calls to a host proxy that
+// speaks real BSD sockets.
+type Backend interface {
+	Socket(domain, typ, proto int) (fd int, err error)
+	Bind(fd int, sa Sockaddr) error
+	Listen(fd int, backlog int) error
+	Accept(fd int) (newfd int, sa Sockaddr, err error)
+	Connect(fd int, sa Sockaddr) error
+	Sendto(fd int, p []byte, flags int, to Sockaddr) error
+	Recvfrom(fd int, p []byte, flags int) (n int, from Sockaddr, err error)
+	Recvmsg(fd int, p, oob []byte, flags int) (n, oobn, recvflags int, from Sockaddr, err error)
+	SendmsgN(fd int, p, oob []byte, to Sockaddr, flags int) (n int, err error)
+	SetReadDeadline(fd int, t int64) error
+	SetWriteDeadline(fd int, t int64) error
+	Shutdown(fd int, how int) error
+	Getpeername(fd int) (sa Sockaddr, err error)
+	Getsockname(fd int) (sa Sockaddr, err error)
+	Close(fd int) error
+	GetsockoptInt(fd, level, opt int) (value int, err error)
+	SetsockoptInt(fd, level, opt, value int) error
+}
+
 func Socket(domain, typ, proto int) (fd int, err error) {
+	return CurrentBackend.Socket(domain, typ, proto)
+}
+
+func StopIO(fd int) error {
+	return ENOSYS
+}
+
+// fakeBackend is the default Backend: the fully in-process simulated
+// network built out of netFile/msgq/byteq below.
+type fakeBackend struct{}
+
+func (fakeBackend) Socket(domain, typ, proto int) (fd int, err error) {
 	fd, _ = socket(domain, typ, proto)
+	if f, ferr := fdToNetFile(fd); ferr == nil {
+		f.sotype = typ
+	}
 	return fd, nil
 }
 
+func (fakeBackend) Close(fd int) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	if f.rd != nil {
+		f.rd.close()
+	}
+	if f.wr != nil {
+		f.wr.close()
+	}
+	if f.listener != nil {
+		f.listener.close()
+	}
+	if f.packet != nil {
+		f.packet.close()
+	}
+	sockets.unbind(f.addr)
+	return nil
+}
+
+// sockets is the global registry of bound addresses, split per address
+// family so that AF_INET, AF_INET6 and AF_UNIX each get their own
+// namespace, mirroring how the kernel keeps separate port spaces.
+var sockets = &socketRegistry{
+	inet4:    make(map[SockaddrInet4]*netFile),
+	inet6:    make(map[SockaddrInet6]*netFile),
+	unix:     make(map[SockaddrUnix]*netFile),
+	nextPort: 1023,
+}
+
+type socketRegistry struct {
+	sync.Mutex
+	inet4    map[SockaddrInet4]*netFile
+	inet6    map[SockaddrInet6]*netFile
+	unix     map[SockaddrUnix]*netFile
+	nextPort int
+}
+
+// autoPort hands out the next ephemeral port, used whenever Bind is
+// asked to pick one automatically (Port == 0) and by Connect for every
+// client-side stream address.
+func (s *socketRegistry) autoPort() int {
+	s.nextPort++
+	if s.nextPort > 1<<16-1 {
+		s.nextPort = 1024
+	}
+	return s.nextPort
+}
+
+func (s *socketRegistry) lookup(sa Sockaddr) (*netFile, bool) {
+	s.Lock()
+	defer s.Unlock()
+	switch a := sa.(type) {
+	case *SockaddrInet4:
+		f, ok := s.inet4[*a]
+		return f, ok
+	case *SockaddrInet6:
+		f, ok := s.inet6[*a]
+		return f, ok
+	case *SockaddrUnix:
+		f, ok := s.unix[*a]
+		return f, ok
+	}
+	return nil, false
+}
+
+func (s *socketRegistry) unbind(sa Sockaddr) {
+	if sa == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	switch a := sa.(type) {
+	case *SockaddrInet4:
+		delete(s.inet4, *a)
+	case *SockaddrInet6:
+		delete(s.inet6, *a)
+	case *SockaddrUnix:
+		delete(s.unix, *a)
+	}
+}
+
+var inet4Proto = netproto{bind: bindInet4}
+var inet6Proto = netproto{bind: bindInet6}
+var unixProto = netproto{bind: bindUnix}
+
+func netprotoFor(sa Sockaddr) (*netproto, error) {
+	switch sa.(type) {
+	case *SockaddrInet4:
+		return &inet4Proto, nil
+	case *SockaddrInet6:
+		return &inet6Proto, nil
+	case *SockaddrUnix:
+		return &unixProto, nil
+	}
+	return nil, EINVAL
+}
+
+func bindInet4(f *netFile, sa Sockaddr) error {
+	a, ok := sa.(*SockaddrInet4)
+	if !ok {
+		return EINVAL
+	}
+	sockets.Lock()
+	defer sockets.Unlock()
+	if a.Port == 0 {
+		a.Port = sockets.autoPort()
+	}
+	if _, dup := sockets.inet4[*a]; dup {
+		return EADDRINUSE
+	}
+	sockets.inet4[*a] = f
+	f.addr = a
+	return nil
+}
+
+func bindInet6(f *netFile, sa Sockaddr) error {
+	a, ok := sa.(*SockaddrInet6)
+	if !ok {
+		return EINVAL
+	}
+	sockets.Lock()
+	defer sockets.Unlock()
+	if a.Port == 0 {
+		a.Port = sockets.autoPort()
+	}
+	if _, dup := sockets.inet6[*a]; dup {
+		return EADDRINUSE
+	}
+	sockets.inet6[*a] = f
+	f.addr = a
+	return nil
+}
+
+func bindUnix(f *netFile, sa Sockaddr) error {
+	a, ok := sa.(*SockaddrUnix)
+	if !ok {
+		return EINVAL
+	}
+	sockets.Lock()
+	defer sockets.Unlock()
+	if _, dup := sockets.unix[*a]; dup {
+		return EADDRINUSE
+	}
+	sockets.unix[*a] = f
+	f.addr = a
+	return nil
+}
+
 func Bind(fd int, sa Sockaddr) error {
-	return ENOSYS
+	return CurrentBackend.Bind(fd, sa)
 }
 
-func StopIO(fd int) error {
-	return ENOSYS
+func (fakeBackend) Bind(fd int, sa Sockaddr) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	proto, err := netprotoFor(sa)
+	if err != nil {
+		return err
+	}
+	f.proto = proto
+	if err := proto.bind(f, sa.copy()); err != nil {
+		return err
+	}
+	if f.sotype == SOCK_DGRAM && f.packet == nil {
+		f.packet = newMsgq()
+	}
+	return nil
 }
 
 func Listen(fd int, backlog int) error {
-	return ENOSYS
+	return CurrentBackend.Listen(fd, backlog)
+}
+
+func (fakeBackend) Listen(fd int, backlog int) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	if f.addr == nil {
+		return EINVAL
+	}
+	if f.listener == nil {
+		f.listener = newMsgq()
+	}
+	return nil
 }
 
 func Accept(fd int) (newfd int, sa Sockaddr, err error) {
-	return 0, nil, ENOSYS
+	return CurrentBackend.Accept(fd)
+}
+
+func (fakeBackend) Accept(fd int) (newfd int, sa Sockaddr, err error) {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	if f.listener == nil {
+		return 0, nil, EINVAL
+	}
+	m, err := f.listener.dequeue(f.rddeadline)
+	if err != nil {
+		return 0, nil, err
+	}
+	conn := m.(*netFile)
+	newfd = newFD(conn)
+	return newfd, conn.raddr.copy(), nil
 }
 
 func Connect(fd int, sa Sockaddr) error {
-	return ENOSYS
+	return CurrentBackend.Connect(fd, sa)
+}
+
+func (fakeBackend) Connect(fd int, sa Sockaddr) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	if f.sotype == SOCK_DGRAM {
+		f.raddr = sa.copy()
+		return nil
+	}
+
+	peer, ok := sockets.lookup(sa)
+	if !ok || peer.listener == nil {
+		return ECONNREFUSED
+	}
+
+	clientAddr := sa.copy()
+	switch a := clientAddr.(type) {
+	case *SockaddrInet4:
+		a.Port = sockets.autoPort()
+	case *SockaddrInet6:
+		a.Port = sockets.autoPort()
+	}
+
+	toPeer := newByteq()
+	toClient := newByteq()
+
+	f.rd = toClient
+	f.wr = toPeer
+	f.addr = clientAddr
+	f.raddr = sa.copy()
+
+	conn := &netFile{
+		proto:  peer.proto,
+		sotype: peer.sotype,
+		rd:     toPeer,
+		wr:     toClient,
+		addr:   sa.copy(),
+		raddr:  clientAddr,
+	}
+
+	// Only AF_UNIX can carry SCM_RIGHTS oob data, so only it needs the
+	// frame queues that let Recvmsg correlate oob bytes with the payload
+	// that produced them. Wiring these up for every stream socket capped
+	// any plain TCP connection at 32 outstanding SendmsgN calls (the
+	// msgq's fixed capacity), since one frame is enqueued per call
+	// regardless of whether it actually carries oob.
+	if _, unix := sa.(*SockaddrUnix); unix {
+		framesToPeer := newMsgq()
+		framesToClient := newMsgq()
+		f.rframes = framesToClient
+		f.wframes = framesToPeer
+		conn.rframes = framesToPeer
+		conn.wframes = framesToClient
+	}
+
+	return peer.listener.enqueue(conn, 0)
+}
+
+// packetMsg is one datagram in transit between two SOCK_DGRAM netFiles.
+type packetMsg struct {
+	from Sockaddr
+	data []byte
 }
 
 func Recvfrom(fd int, p []byte, flags int) (n int, from Sockaddr, err error) {
-	return 0, nil, ENOSYS
+	return CurrentBackend.Recvfrom(fd, p, flags)
+}
+
+func (fakeBackend) Recvfrom(fd int, p []byte, flags int) (n int, from Sockaddr, err error) {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	if f.sotype != SOCK_DGRAM {
+		return 0, nil, EINVAL
+	}
+	if f.packet == nil {
+		f.packet = newMsgq()
+	}
+	m, err := f.packet.dequeue(f.rddeadline)
+	if err != nil {
+		return 0, nil, err
+	}
+	msg := m.(*packetMsg)
+	n = copy(p, msg.data)
+	return n, msg.from, nil
 }
 
 func Sendto(fd int, p []byte, flags int, to Sockaddr) error {
-	return ENOSYS
+	return CurrentBackend.Sendto(fd, p, flags, to)
+}
+
+func (fakeBackend) Sendto(fd int, p []byte, flags int, to Sockaddr) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	if f.sotype != SOCK_DGRAM {
+		return EINVAL
+	}
+	peer, ok := sockets.lookup(to)
+	if !ok || peer.packet == nil {
+		return ECONNREFUSED
+	}
+	b := make([]byte, len(p))
+	copy(b, p)
+	from := f.addr
+	if from == nil {
+		from = to.copy()
+	}
+	return peer.packet.enqueue(&packetMsg{from: from.copy(), data: b}, f.wrdeadline)
 }
 
 func Recvmsg(fd int, p, oob []byte, flags int) (n, oobn, recvflags int, from Sockaddr, err error) {
-	return 0, 0, 0, nil, ENOSYS
+	return CurrentBackend.Recvmsg(fd, p, oob, flags)
+}
+
+func (fakeBackend) Recvmsg(fd int, p, oob []byte, flags int) (n, oobn, recvflags int, from Sockaddr, err error) {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	if f.sotype == SOCK_DGRAM {
+		n, from, err = Recvfrom(fd, p, flags)
+		return n, 0, 0, from, err
+	}
+	if f.rd == nil {
+		return 0, 0, 0, nil, ENOTCONN
+	}
+	if f.curFrameRemaining == 0 && f.rframes != nil {
+		m, err := f.rframes.dequeue(f.rddeadline)
+		if err != nil {
+			return 0, 0, 0, nil, err
+		}
+		fr := m.(*sendFrame)
+		if fr.n == 0 {
+			// An oob-only (or empty) send: nothing to read, deliver the
+			// oob now rather than blocking on bytes that never come.
+			oobn = copy(oob, fr.oob)
+			return 0, oobn, 0, f.raddr, nil
+		}
+		f.curFrameRemaining = fr.n
+		f.curFrameOOB = fr.oob
+	}
+	max := len(p)
+	if f.rframes != nil && max > f.curFrameRemaining {
+		max = f.curFrameRemaining
+	}
+	n, err = f.rd.read(p[:max], f.rddeadline)
+	if err != nil {
+		return n, 0, 0, f.raddr, err
+	}
+	f.curFrameRemaining -= n
+	if len(oob) > 0 && f.curFrameOOB != nil {
+		oobn = copy(oob, f.curFrameOOB)
+		f.curFrameOOB = nil
+	}
+	return n, oobn, 0, f.raddr, nil
 }
 
 func SendmsgN(fd int, p, oob []byte, to Sockaddr, flags int) (n int, err error) {
-	return 0, ENOSYS
+	return CurrentBackend.SendmsgN(fd, p, oob, to, flags)
+}
+
+func (fakeBackend) SendmsgN(fd int, p, oob []byte, to Sockaddr, flags int) (n int, err error) {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return 0, err
+	}
+	if to != nil {
+		if err := Sendto(fd, p, flags, to); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if f.wr == nil {
+		return 0, ENOTCONN
+	}
+	if f.wframes != nil {
+		var b []byte
+		if len(oob) > 0 {
+			b = make([]byte, len(oob))
+			copy(b, oob)
+		}
+		if err := f.wframes.enqueue(&sendFrame{n: len(p), oob: b}, f.wrdeadline); err != nil {
+			return 0, err
+		}
+	}
+	return f.wr.write(p, f.wrdeadline)
+}
+
+// sockopts tracked for compatibility with package net; the simulated
+// network has no kernel buffers or keepalive probes to actually tune,
+// so these are simply recorded and echoed back.
+var settableSockopts = map[int]bool{
+	SO_KEEPALIVE:      true,
+	SO_RCVBUF:         true,
+	SO_SNDBUF:         true,
+	TCP_NODELAY:       true,
+	SO_REUSEADDR:      true,
+	IP_ADD_MEMBERSHIP: true,
+	IPV6_JOIN_GROUP:   true,
 }
 
 func GetsockoptInt(fd, level, opt int) (value int, err error) {
-	return 0, ENOSYS
+	return CurrentBackend.GetsockoptInt(fd, level, opt)
+}
+
+func (fakeBackend) GetsockoptInt(fd, level, opt int) (value int, err error) {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return 0, err
+	}
+	if f.sockopts != nil {
+		if v, ok := f.sockopts[opt]; ok {
+			return v, nil
+		}
+	}
+	return 0, nil
 }
 
 func SetsockoptInt(fd, level, opt int, value int) error {
+	return CurrentBackend.SetsockoptInt(fd, level, opt, value)
+}
+
+func (fakeBackend) SetsockoptInt(fd, level, opt int, value int) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return nil
+	}
+	if !settableSockopts[opt] {
+		return nil
+	}
+	if f.sockopts == nil {
+		f.sockopts = make(map[int]int)
+	}
+	f.sockopts[opt] = value
 	return nil
 }
 
 func SetReadDeadline(fd int, t int64) error {
-	return ENOSYS
+	return CurrentBackend.SetReadDeadline(fd, t)
+}
+
+func (fakeBackend) SetReadDeadline(fd int, t int64) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	f.rddeadline = t
+	if f.rd != nil {
+		f.rd.Lock()
+		if f.rd.rtimer != nil {
+			f.rd.rtimer.reset(&f.rd.queue, t)
+		}
+		f.rd.Unlock()
+	}
+	if f.listener != nil {
+		f.listener.Lock()
+		if f.listener.rtimer != nil {
+			f.listener.rtimer.reset(&f.listener.queue, t)
+		}
+		f.listener.Unlock()
+	}
+	if f.packet != nil {
+		f.packet.Lock()
+		if f.packet.rtimer != nil {
+			f.packet.rtimer.reset(&f.packet.queue, t)
+		}
+		f.packet.Unlock()
+	}
+	return nil
 }
 
 func SetWriteDeadline(fd int, t int64) error {
-	return ENOSYS
+	return CurrentBackend.SetWriteDeadline(fd, t)
+}
+
+func (fakeBackend) SetWriteDeadline(fd int, t int64) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	f.wrdeadline = t
+	if f.wr != nil {
+		f.wr.Lock()
+		if f.wr.wtimer != nil {
+			f.wr.wtimer.reset(&f.wr.queue, t)
+		}
+		f.wr.Unlock()
+	}
+	return nil
 }
 
 func Shutdown(fd int, how int) error {
-	return ENOSYS
+	return CurrentBackend.Shutdown(fd, how)
+}
+
+func (fakeBackend) Shutdown(fd int, how int) error {
+	f, err := fdToNetFile(fd)
+	if err != nil {
+		return err
+	}
+	switch how {
+	case SHUT_RD:
+		if f.rd != nil {
+			f.rd.close()
+		}
+	case SHUT_WR:
+		if f.wr != nil {
+			f.wr.close()
+		}
+	case SHUT_RDWR:
+		if f.rd != nil {
+			f.rd.close()
+		}
+		if f.wr != nil {
+			f.wr.close()
+		}
+	default:
+		return EINVAL
+	}
+	sockets.unbind(f.addr)
+	return nil
 }
 
 func SetNonblock(fd int, nonblocking bool) error {
@@ -233,6 +773,10 @@ func fdToNetFile(fd int) (*netFile, error) {
 }
 
 func Getpeername(fd int) (sa Sockaddr, err error) {
+	return CurrentBackend.Getpeername(fd)
+}
+
+func (fakeBackend) Getpeername(fd int) (sa Sockaddr, err error) {
 	f, err := fdToNetFile(fd)
 	if err != nil {
 		return nil, err
@@ -244,6 +788,10 @@ func Getpeername(fd int) (sa Sockaddr, err error) {
 }
 
 func Getsockname(fd int) (sa Sockaddr, err error) {
+	return CurrentBackend.Getsockname(fd)
+}
+
+func (fakeBackend) Getsockname(fd int) (sa Sockaddr, err error) {
 	f, err := fdToNetFile(fd)
 	if err != nil {
 		return nil, err
@@ -268,6 +816,53 @@ func newMsgq() *msgq {
 	return q
 }
 
+// enqueue adds m to the queue, blocking until there is room or deadline
+// passes.
+func (q *msgq) enqueue(m interface{}, deadline int64) error {
+	q.Lock()
+	defer q.Unlock()
+	if _, err := q.waitWrite(1, deadline); err != nil {
+		return err
+	}
+	q.data[q.w&q.m] = m
+	q.w++
+	return nil
+}
+
+// dequeue removes and returns the oldest message, blocking until one
+// arrives or deadline passes. A closed queue with nothing left in it
+// yields EINVAL.
+func (q *msgq) dequeue(deadline int64) (interface{}, error) {
+	q.Lock()
+	defer q.Unlock()
+	n, err := q.waitRead(1, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, EINVAL
+	}
+	m := q.data[q.r&q.m]
+	q.data[q.r&q.m] = nil
+	q.r++
+	return m, nil
+}
+
+// tryDequeue removes and returns the oldest message without blocking,
+// reporting false if the queue is currently empty.
+func (q *msgq) tryDequeue() (interface{}, bool) {
+	q.Lock()
+	defer q.Unlock()
+	if q.w-q.r == 0 {
+		return nil, false
+	}
+	m := q.data[q.r&q.m]
+	q.data[q.r&q.m] = nil
+	q.r++
+	q.canWrite.Signal()
+	return m, true
+}
+
 // A netproto contains protocol-specific functionality
 // (one for AF_INET, one for AF_INET6 and so on).
 // It is a struct instead of an interface because the
@@ -290,6 +885,30 @@ type netFile struct {
 	wrdeadline int64
 	addr       Sockaddr
 	raddr      Sockaddr
+	sockopts   map[int]int
+
+	// wframes/rframes carry one sendFrame descriptor per SendmsgN call,
+	// each recording how many of the bytes about to land in wr/rd belong
+	// to that call and the out-of-band bytes (e.g. SCM_RIGHTS payloads
+	// for AF_UNIX) sent alongside them. Recvmsg consumes descriptors off
+	// rframes in lockstep with the bytes it reads off rd so oob is
+	// returned on the first read of the matching frame's bytes that
+	// supplies an oob buffer, never misattributed to another frame.
+	wframes *msgq
+	rframes *msgq
+
+	// curFrameRemaining/curFrameOOB track the in-progress frame a
+	// Recvmsg call is partway through delivering.
+	curFrameRemaining int
+	curFrameOOB       []byte
+}
+
+// sendFrame records the length and out-of-band payload of a single
+// SendmsgN call so a later Recvmsg can return the oob bytes together
+// with the first bytes it reads of that call's payload.
+type sendFrame struct {
+	n   int
+	oob []byte
 }
 
 // Interface to timers implemented in package runtime.
@@ -497,6 +1116,504 @@ func (q *byteq) write(b []byte, deadline int64) (n int, err error) {
 	return n, nil
 }
 
+// --- Host-bridged backend ------------------------------------------------
+//
+// rpcBackend ships the same socket calls over a small binary framing to
+// a host-side proxy that speaks real BSD sockets, modeled on gVisor's
+// rpcinet. A frame is [1-byte op][4-byte big-endian request id][payload];
+// the host echoes the request id on its reply frame so concurrent calls
+// can be matched up. Port is deliberately not syscall/js.Value itself
+// (this package cannot import package js) - callers supply a Port that
+// wraps whatever message channel (e.g. a js.Value with postMessage) they
+// chose to expose the host side on.
+
+type rpcOp byte
+
+const (
+	rpcOpSocket rpcOp = iota + 1
+	rpcOpBind
+	rpcOpListen
+	rpcOpAccept
+	rpcOpConnect
+	rpcOpSend
+	rpcOpRecv
+	rpcOpSendmsg
+	rpcOpRecvmsg
+	rpcOpShutdown
+	rpcOpClose
+	rpcOpGetsockopt
+	rpcOpSetsockopt
+	rpcOpReady // host -> client: fd became readable/writable/both
+)
+
+// Port is the host-facing side of the bridge.
+type Port interface {
+	Post(frame []byte)
+}
+
+type rpcRequest struct {
+	reply chan []byte
+}
+
+// rpcFile tracks the state Recvmsg/SendmsgN/Getpeername/Getsockname/
+// SetReadDeadline/SetWriteDeadline need for an fd whose bytes never
+// pass through the local fake-net tables in fdToNetFile: the socket
+// type and addresses learned from Socket/Bind/Connect, the deadlines
+// set by SetReadDeadline/SetWriteDeadline, and the readiness queue
+// that Deliver's rpcOpReady frames broadcast on.
+type rpcFile struct {
+	queue
+	sotype                 int
+	addr, raddr            Sockaddr
+	rddeadline, wrdeadline int64
+}
+
+// rpcBackend implements Backend by forwarding every call across a Port
+// to a host proxy. Per-fd notifier state translates the host's
+// EPOLL-style readiness frames into canRead/canWrite broadcasts on a
+// local queue. rpcBackend's own calls do not wait on that queue: each
+// one blocks on the host's reply frame, bounded by the fd's read or
+// write deadline through a deadlineTimer.
+type rpcBackend struct {
+	port Port
+
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]*rpcRequest
+
+	filesMu sync.Mutex
+	files   map[int]*rpcFile
+}
+
+// NewRPCBackend wraps port as a Backend. Pass the result to SetBackend
+// to have Socket/Bind/Listen/... reach the real network through port.
+func NewRPCBackend(port Port) *rpcBackend {
+	return &rpcBackend{
+		port:    port,
+		pending: make(map[uint32]*rpcRequest),
+		files:   make(map[int]*rpcFile),
+	}
+}
+
+// Deliver feeds one frame received from the host port back into the
+// backend: either the reply to a pending call, or an unsolicited
+// readiness notification for a watched fd.
+func (b *rpcBackend) Deliver(frame []byte) {
+	if len(frame) < 5 {
+		return
+	}
+	op := rpcOp(frame[0])
+	id := binary.BigEndian.Uint32(frame[1:5])
+	if op == rpcOpReady {
+		if len(frame) < 10 {
+			return
+		}
+		fd := int(binary.BigEndian.Uint32(frame[5:9]))
+		mask := frame[9]
+		f := b.fileFor(fd)
+		if f == nil {
+			return
+		}
+		f.Lock()
+		if mask&1 != 0 {
+			f.canRead.Broadcast()
+		}
+		if mask&2 != 0 {
+			f.canWrite.Broadcast()
+		}
+		f.Unlock()
+		return
+	}
+	b.mu.Lock()
+	req := b.pending[id]
+	delete(b.pending, id)
+	b.mu.Unlock()
+	if req != nil {
+		req.reply <- frame[5:]
+	}
+}
+
+// call sends op/payload to the host and blocks for the matching reply,
+// or until deadline passes (0 means wait forever, same convention as
+// rddeadline/wrdeadline elsewhere in this file). A non-zero first reply
+// byte is the host's errno.
+func (b *rpcBackend) call(op rpcOp, payload []byte, deadline int64) ([]byte, error) {
+	b.mu.Lock()
+	b.nextID++
+	id := b.nextID
+	req := &rpcRequest{reply: make(chan []byte, 1)}
+	b.pending[id] = req
+	b.mu.Unlock()
+
+	frame := make([]byte, 5+len(payload))
+	frame[0] = byte(op)
+	binary.BigEndian.PutUint32(frame[1:5], id)
+	copy(frame[5:], payload)
+	b.port.Post(frame)
+
+	dt := newDeadlineTimer(deadline)
+	defer dt.stop()
+
+	select {
+	case reply := <-req.reply:
+		if len(reply) == 0 {
+			return nil, EINVAL
+		}
+		if reply[0] != 0 {
+			return nil, Errno(reply[0])
+		}
+		return reply[1:], nil
+	case <-dt.done():
+		b.mu.Lock()
+		delete(b.pending, id)
+		b.mu.Unlock()
+		return nil, EAGAIN
+	}
+}
+
+// deadlineTimer fires its channel once, after deadline elapses, reusing
+// the runtimeTimer plumbing the rest of this file already has for
+// byteq/msgq deadlines. Unlike the queue-oriented timer type above, call
+// has nothing to Lock or broadcast on - it's just racing a channel
+// receive against a wall-clock deadline - so this wraps a plain channel
+// instead.
+type deadlineTimer struct {
+	r runtimeTimer
+	c chan struct{}
+}
+
+// newDeadlineTimer returns nil for a zero deadline; done() on a nil
+// *deadlineTimer returns a nil channel, which blocks forever in a
+// select, exactly like "no deadline" should behave.
+func newDeadlineTimer(deadline int64) *deadlineTimer {
+	if deadline == 0 {
+		return nil
+	}
+	dt := &deadlineTimer{c: make(chan struct{})}
+	if past(deadline) {
+		close(dt.c)
+		return dt
+	}
+	dt.r.when = deadline
+	dt.r.f = deadlineTimerExpired
+	dt.r.arg = dt
+	startTimer(&dt.r)
+	return dt
+}
+
+func deadlineTimerExpired(i interface{}, seq uintptr) {
+	go close(i.(*deadlineTimer).c)
+}
+
+func (dt *deadlineTimer) done() <-chan struct{} {
+	if dt == nil {
+		return nil
+	}
+	return dt.c
+}
+
+func (dt *deadlineTimer) stop() {
+	if dt == nil || dt.r.f == nil {
+		return
+	}
+	stopTimer(&dt.r)
+}
+
+// watch registers f as fd's state, the notifier goroutine equivalent:
+// subsequent Deliver calls for fd wake up whatever is parked in
+// f.waitRead/f.waitWrite, and Recvmsg/SendmsgN/Getpeername/Getsockname
+// read back the addr/raddr/deadlines recorded on it.
+func (b *rpcBackend) watch(fd int, f *rpcFile) {
+	b.filesMu.Lock()
+	b.files[fd] = f
+	b.filesMu.Unlock()
+}
+
+// fileFor returns the state registered for fd by watch, or nil if fd is
+// unknown to this backend.
+func (b *rpcBackend) fileFor(fd int) *rpcFile {
+	b.filesMu.Lock()
+	f := b.files[fd]
+	b.filesMu.Unlock()
+	return f
+}
+
+func encodeSockaddr(sa Sockaddr) []byte {
+	switch a := sa.(type) {
+	case *SockaddrInet4:
+		b := make([]byte, 1+2+4)
+		b[0] = AF_INET
+		binary.BigEndian.PutUint16(b[1:3], uint16(a.Port))
+		copy(b[3:], a.Addr[:])
+		return b
+	case *SockaddrInet6:
+		b := make([]byte, 1+2+16)
+		b[0] = AF_INET6
+		binary.BigEndian.PutUint16(b[1:3], uint16(a.Port))
+		copy(b[3:], a.Addr[:])
+		return b
+	case *SockaddrUnix:
+		b := make([]byte, 1+len(a.Name))
+		b[0] = AF_UNIX
+		copy(b[1:], a.Name)
+		return b
+	}
+	return nil
+}
+
+// decodeSockaddr is encodeSockaddr's inverse, used to read a peer
+// address the host reports back to us (e.g. in an Accept reply). An
+// empty b means the host didn't report an address; that's not an error,
+// just a nil Sockaddr.
+func decodeSockaddr(b []byte) (Sockaddr, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	switch b[0] {
+	case AF_INET:
+		if len(b) < 1+2+4 {
+			return nil, EINVAL
+		}
+		sa := &SockaddrInet4{Port: int(binary.BigEndian.Uint16(b[1:3]))}
+		copy(sa.Addr[:], b[3:7])
+		return sa, nil
+	case AF_INET6:
+		if len(b) < 1+2+16 {
+			return nil, EINVAL
+		}
+		sa := &SockaddrInet6{Port: int(binary.BigEndian.Uint16(b[1:3]))}
+		copy(sa.Addr[:], b[3:19])
+		return sa, nil
+	case AF_UNIX:
+		return &SockaddrUnix{Name: string(b[1:])}, nil
+	}
+	return nil, EINVAL
+}
+
+func (b *rpcBackend) Socket(domain, typ, proto int) (fd int, err error) {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[0:4], uint32(domain))
+	binary.BigEndian.PutUint32(payload[4:8], uint32(typ))
+	binary.BigEndian.PutUint32(payload[8:12], uint32(proto))
+	reply, err := b.call(rpcOpSocket, payload, 0)
+	if err != nil {
+		return 0, err
+	}
+	fd = int(binary.BigEndian.Uint32(reply))
+	b.watch(fd, &rpcFile{sotype: typ})
+	return fd, nil
+}
+
+func (b *rpcBackend) Bind(fd int, sa Sockaddr) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(fd))
+	_, err := b.call(rpcOpBind, append(payload, encodeSockaddr(sa)...), 0)
+	if err == nil {
+		if f := b.fileFor(fd); f != nil {
+			f.addr = sa.copy()
+		}
+	}
+	return err
+}
+
+func (b *rpcBackend) Listen(fd int, backlog int) error {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint32(payload[0:4], uint32(fd))
+	binary.BigEndian.PutUint32(payload[4:8], uint32(backlog))
+	_, err := b.call(rpcOpListen, payload, 0)
+	return err
+}
+
+func (b *rpcBackend) Accept(fd int) (newfd int, sa Sockaddr, err error) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(fd))
+	var deadline int64
+	if f := b.fileFor(fd); f != nil {
+		deadline = f.rddeadline
+	}
+	reply, err := b.call(rpcOpAccept, payload, deadline)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(reply) < 4 {
+		return 0, nil, EINVAL
+	}
+	newfd = int(binary.BigEndian.Uint32(reply[:4]))
+	peer, err := decodeSockaddr(reply[4:])
+	if err != nil {
+		return 0, nil, err
+	}
+	b.watch(newfd, &rpcFile{sotype: SOCK_STREAM, raddr: peer})
+	if peer == nil {
+		return newfd, nil, nil
+	}
+	return newfd, peer.copy(), nil
+}
+
+func (b *rpcBackend) Connect(fd int, sa Sockaddr) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(fd))
+	_, err := b.call(rpcOpConnect, append(payload, encodeSockaddr(sa)...), 0)
+	if err == nil {
+		if f := b.fileFor(fd); f != nil {
+			f.raddr = sa.copy()
+		}
+	}
+	return err
+}
+
+func (b *rpcBackend) Sendto(fd int, p []byte, flags int, to Sockaddr) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(fd))
+	payload = append(payload, encodeSockaddr(to)...)
+	payload = append(payload, p...)
+	var deadline int64
+	if f := b.fileFor(fd); f != nil {
+		deadline = f.wrdeadline
+	}
+	_, err := b.call(rpcOpSend, payload, deadline)
+	return err
+}
+
+func (b *rpcBackend) Recvfrom(fd int, p []byte, flags int) (n int, from Sockaddr, err error) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(fd))
+	var deadline int64
+	if f := b.fileFor(fd); f != nil {
+		deadline = f.rddeadline
+	}
+	reply, err := b.call(rpcOpRecv, payload, deadline)
+	if err != nil {
+		return 0, nil, err
+	}
+	n = copy(p, reply)
+	return n, nil, nil
+}
+
+func (b *rpcBackend) Close(fd int) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(fd))
+	_, err := b.call(rpcOpClose, payload, 0)
+	b.filesMu.Lock()
+	delete(b.files, fd)
+	b.filesMu.Unlock()
+	return err
+}
+
+func (b *rpcBackend) Recvmsg(fd int, p, oob []byte, flags int) (n, oobn, recvflags int, from Sockaddr, err error) {
+	f := b.fileFor(fd)
+	if f != nil && f.sotype == SOCK_DGRAM {
+		n, from, err = b.Recvfrom(fd, p, flags)
+		return n, 0, 0, from, err
+	}
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(fd))
+	var deadline int64
+	if f != nil {
+		deadline = f.rddeadline
+	}
+	reply, err := b.call(rpcOpRecvmsg, payload, deadline)
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	if len(reply) < 4 {
+		return 0, 0, 0, nil, EINVAL
+	}
+	oobLen := int(binary.BigEndian.Uint32(reply[:4]))
+	rest := reply[4:]
+	if oobLen > len(rest) {
+		return 0, 0, 0, nil, EINVAL
+	}
+	oobn = copy(oob, rest[:oobLen])
+	n = copy(p, rest[oobLen:])
+	if f != nil {
+		from = f.raddr
+	}
+	return n, oobn, 0, from, nil
+}
+
+func (b *rpcBackend) SendmsgN(fd int, p, oob []byte, to Sockaddr, flags int) (n int, err error) {
+	if to != nil {
+		if err := b.Sendto(fd, p, flags, to); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint32(payload[0:4], uint32(fd))
+	binary.BigEndian.PutUint32(payload[4:8], uint32(len(oob)))
+	payload = append(payload, oob...)
+	payload = append(payload, p...)
+	var deadline int64
+	if f := b.fileFor(fd); f != nil {
+		deadline = f.wrdeadline
+	}
+	if _, err := b.call(rpcOpSendmsg, payload, deadline); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (b *rpcBackend) SetReadDeadline(fd int, t int64) error {
+	if f := b.fileFor(fd); f != nil {
+		f.rddeadline = t
+	}
+	return nil
+}
+
+func (b *rpcBackend) SetWriteDeadline(fd int, t int64) error {
+	if f := b.fileFor(fd); f != nil {
+		f.wrdeadline = t
+	}
+	return nil
+}
+
+func (b *rpcBackend) Shutdown(fd int, how int) error {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint32(payload[0:4], uint32(fd))
+	binary.BigEndian.PutUint32(payload[4:8], uint32(how))
+	_, err := b.call(rpcOpShutdown, payload, 0)
+	return err
+}
+
+func (b *rpcBackend) Getpeername(fd int) (sa Sockaddr, err error) {
+	f := b.fileFor(fd)
+	if f == nil || f.raddr == nil {
+		return nil, ENOTCONN
+	}
+	return f.raddr.copy(), nil
+}
+
+func (b *rpcBackend) Getsockname(fd int) (sa Sockaddr, err error) {
+	f := b.fileFor(fd)
+	if f == nil || f.addr == nil {
+		return nil, ENOTCONN
+	}
+	return f.addr.copy(), nil
+}
+
+func (b *rpcBackend) GetsockoptInt(fd, level, opt int) (value int, err error) {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[0:4], uint32(fd))
+	binary.BigEndian.PutUint32(payload[4:8], uint32(level))
+	binary.BigEndian.PutUint32(payload[8:12], uint32(opt))
+	reply, err := b.call(rpcOpGetsockopt, payload, 0)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint32(reply)), nil
+}
+
+func (b *rpcBackend) SetsockoptInt(fd, level, opt, value int) error {
+	payload := make([]byte, 16)
+	binary.BigEndian.PutUint32(payload[0:4], uint32(fd))
+	binary.BigEndian.PutUint32(payload[4:8], uint32(level))
+	binary.BigEndian.PutUint32(payload[8:12], uint32(opt))
+	binary.BigEndian.PutUint32(payload[12:16], uint32(value))
+	_, err := b.call(rpcOpSetsockopt, payload, 0)
+	return err
+}
+
 // RoutingMessage represents a routing message.
 type RoutingMessage interface {
 	unimplemented()
@@ -0,0 +1,243 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build js,wasm
+
+package syscall
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// fakePort is a Port whose host side is a Go callback instead of a real
+// process across a postMessage bridge, so rpcBackend's framing and
+// deadline handling can be exercised without an actual host.
+type fakePort struct {
+	backend *rpcBackend
+	// handler computes the reply body (errno byte followed by data) for
+	// one request; returning nil simulates a host that never answers.
+	handler func(op rpcOp, id uint32, payload []byte) []byte
+}
+
+func (p *fakePort) Post(frame []byte) {
+	op := rpcOp(frame[0])
+	id := binary.BigEndian.Uint32(frame[1:5])
+	body := p.handler(op, id, frame[5:])
+	if body == nil {
+		return
+	}
+	reply := make([]byte, 5+len(body))
+	reply[0] = frame[0]
+	binary.BigEndian.PutUint32(reply[1:5], id)
+	copy(reply[5:], body)
+	p.backend.Deliver(reply)
+}
+
+func newFakeRPCBackend(handler func(op rpcOp, id uint32, payload []byte) []byte) *rpcBackend {
+	port := &fakePort{handler: handler}
+	backend := NewRPCBackend(port)
+	port.backend = backend
+	return backend
+}
+
+func TestRPCBackendAcceptDecodesPeerAddress(t *testing.T) {
+	peer := &SockaddrInet4{Port: 4242, Addr: [4]byte{10, 0, 0, 7}}
+	backend := newFakeRPCBackend(func(op rpcOp, id uint32, payload []byte) []byte {
+		if op != rpcOpAccept {
+			t.Fatalf("unexpected op %v", op)
+		}
+		body := make([]byte, 5)
+		binary.BigEndian.PutUint32(body[1:5], 42)
+		return append(body, encodeSockaddr(peer)...)
+	})
+	backend.watch(10, &rpcFile{sotype: SOCK_STREAM})
+
+	newfd, sa, err := backend.Accept(10)
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	if newfd != 42 {
+		t.Fatalf("got fd %d, want 42", newfd)
+	}
+	got, ok := sa.(*SockaddrInet4)
+	if !ok || *got != *peer {
+		t.Fatalf("got peer %#v, want %#v", sa, peer)
+	}
+
+	peername, err := backend.Getpeername(newfd)
+	if err != nil {
+		t.Fatalf("getpeername: %v", err)
+	}
+	if got, ok := peername.(*SockaddrInet4); !ok || *got != *peer {
+		t.Fatalf("getpeername = %#v, want %#v", peername, peer)
+	}
+}
+
+// TestRPCBackendCallHonorsDeadline simulates a host that never replies
+// and checks a read deadline still unblocks the caller, rather than
+// hanging forever the way call() used to before it raced the reply
+// against a deadlineTimer.
+func TestRPCBackendCallHonorsDeadline(t *testing.T) {
+	backend := newFakeRPCBackend(func(op rpcOp, id uint32, payload []byte) []byte {
+		return nil // never reply
+	})
+	backend.watch(7, &rpcFile{sotype: SOCK_STREAM})
+
+	sec, nsec := now()
+	backend.SetReadDeadline(7, sec*1e9+int64(nsec)+20*1000*1000) // 20ms out
+
+	if _, _, err := backend.Recvfrom(7, make([]byte, 4), 0); err != EAGAIN {
+		t.Fatalf("got err %v, want EAGAIN", err)
+	}
+}
+
+func TestFakeNetStreamRoundTrip(t *testing.T) {
+	lfd, err := Socket(AF_INET, SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("socket: %v", err)
+	}
+	if err := Bind(lfd, &SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if err := Listen(lfd, 1); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	laddr, err := Getsockname(lfd)
+	if err != nil {
+		t.Fatalf("getsockname: %v", err)
+	}
+
+	accepted := make(chan int, 1)
+	acceptErr := make(chan error, 1)
+	go func() {
+		nfd, _, err := Accept(lfd)
+		if err != nil {
+			acceptErr <- err
+			return
+		}
+		accepted <- nfd
+	}()
+
+	cfd, err := Socket(AF_INET, SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("socket: %v", err)
+	}
+	if err := Connect(cfd, laddr); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	var nfd int
+	select {
+	case nfd = <-accepted:
+	case err := <-acceptErr:
+		t.Fatalf("accept: %v", err)
+	}
+
+	want := []byte("hello, wasm")
+	if _, err := SendmsgN(cfd, want, nil, nil, 0); err != nil {
+		t.Fatalf("sendmsg: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	n, _, _, _, err := Recvmsg(nfd, got, nil, 0)
+	if err != nil {
+		t.Fatalf("recvmsg: %v", err)
+	}
+	if string(got[:n]) != string(want) {
+		t.Fatalf("got %q, want %q", got[:n], want)
+	}
+}
+
+func TestFakeNetDgramRoundTrip(t *testing.T) {
+	sfd, err := Socket(AF_INET, SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatalf("socket: %v", err)
+	}
+	if err := Bind(sfd, &SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	saddr, err := Getsockname(sfd)
+	if err != nil {
+		t.Fatalf("getsockname: %v", err)
+	}
+
+	cfd, err := Socket(AF_INET, SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatalf("socket: %v", err)
+	}
+
+	want := []byte("ping")
+	if err := Sendto(cfd, want, 0, saddr); err != nil {
+		t.Fatalf("sendto: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	n, _, err := Recvfrom(sfd, got, 0)
+	if err != nil {
+		t.Fatalf("recvfrom: %v", err)
+	}
+	if string(got[:n]) != string(want) {
+		t.Fatalf("got %q, want %q", got[:n], want)
+	}
+}
+
+func TestFakeNetUnixRoundTripWithOOB(t *testing.T) {
+	lfd, err := Socket(AF_UNIX, SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("socket: %v", err)
+	}
+	laddr := &SockaddrUnix{Name: "/tmp/wasabi-test.sock"}
+	if err := Bind(lfd, laddr); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if err := Listen(lfd, 1); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	accepted := make(chan int, 1)
+	acceptErr := make(chan error, 1)
+	go func() {
+		nfd, _, err := Accept(lfd)
+		if err != nil {
+			acceptErr <- err
+			return
+		}
+		accepted <- nfd
+	}()
+
+	cfd, err := Socket(AF_UNIX, SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("socket: %v", err)
+	}
+	if err := Connect(cfd, laddr); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	var nfd int
+	select {
+	case nfd = <-accepted:
+	case err := <-acceptErr:
+		t.Fatalf("accept: %v", err)
+	}
+
+	want := []byte("fd coming through")
+	oob := []byte{1, 2, 3, 4}
+	if _, err := SendmsgN(cfd, want, oob, nil, 0); err != nil {
+		t.Fatalf("sendmsg: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	gotOOB := make([]byte, len(oob))
+	n, oobn, _, _, err := Recvmsg(nfd, got, gotOOB, 0)
+	if err != nil {
+		t.Fatalf("recvmsg: %v", err)
+	}
+	if string(got[:n]) != string(want) {
+		t.Fatalf("got %q, want %q", got[:n], want)
+	}
+	if string(gotOOB[:oobn]) != string(oob) {
+		t.Fatalf("got oob %v, want %v", gotOOB[:oobn], oob)
+	}
+}
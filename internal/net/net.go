@@ -3,11 +3,13 @@
 package net
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -25,8 +27,13 @@ func Dial(network, addr string) (c net.Conn, err error) {
 	if err != nil {
 		return c, err
 	}
-	if network == "tcp" {
+	switch network {
+	case "tcp":
 		return &TCPConn{tc: c.(*net.TCPConn)}, err
+	case "udp", "udp4", "udp6":
+		return &UDPConn{uc: c.(*net.UDPConn)}, err
+	case "unix", "unixgram", "unixpacket":
+		return &UnixConn{uc: c.(*net.UnixConn)}, err
 	}
 	panic("network not supported")
 }
@@ -35,6 +42,201 @@ func ListenAndServe(addr string, handler http.Handler) error {
 	return http.ListenAndServe(addr, handler)
 }
 
+// Resolver resolves host names to addresses. The zero value delegates
+// to net.DefaultResolver. Callers may set LookupIPAddr/LookupSRV to
+// override resolution, since net.LookupIP/LookupPort are otherwise bare
+// package-level thunks with no override path.
+type Resolver struct {
+	LookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV    func(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+func (r *Resolver) lookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if r != nil && r.LookupIPAddr != nil {
+		return r.LookupIPAddr(ctx, host)
+	}
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
+
+func (r *Resolver) lookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if r != nil && r.LookupSRV != nil {
+		return r.LookupSRV(ctx, service, proto, name)
+	}
+	return net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+}
+
+// Dialer configures a DialContext call. Its fields mirror the
+// like-named fields of net.Dialer, except that Resolver is this
+// package's *Resolver; DualStack and Cancel are absent, and there is
+// no Dial method.
+type Dialer struct {
+	Timeout       time.Duration
+	Deadline      time.Time
+	KeepAlive     time.Duration
+	LocalAddr     net.Addr
+	FallbackDelay time.Duration
+	Resolver      *Resolver
+	Control       func(network, address string, c syscall.RawConn) error
+}
+
+func (d *Dialer) fallbackDelay() time.Duration {
+	if d.FallbackDelay > 0 {
+		return d.FallbackDelay
+	}
+	return 300 * time.Millisecond
+}
+
+func (d *Dialer) netDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   d.Timeout,
+		Deadline:  d.Deadline,
+		KeepAlive: d.KeepAlive,
+		LocalAddr: d.LocalAddr,
+		Control:   d.Control,
+	}
+}
+
+// interleave orders resolved addresses alternating address families,
+// as recommended by RFC 8305, so Happy Eyeballs dials IPv6 and IPv4
+// candidates in turn instead of exhausting one family first.
+func interleave(addrs []net.IPAddr) []net.IPAddr {
+	var v4, v6 []net.IPAddr
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			v4 = append(v4, a)
+		} else {
+			v6 = append(v6, a)
+		}
+	}
+	ordered := make([]net.IPAddr, 0, len(addrs))
+	for len(v4) > 0 || len(v6) > 0 {
+		if len(v6) > 0 {
+			ordered = append(ordered, v6[0])
+			v6 = v6[1:]
+		}
+		if len(v4) > 0 {
+			ordered = append(ordered, v4[0])
+			v4 = v4[1:]
+		}
+	}
+	return ordered
+}
+
+func wrapConn(network string, c net.Conn) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return &TCPConn{tc: c.(*net.TCPConn)}, nil
+	case "udp", "udp4", "udp6":
+		return &UDPConn{uc: c.(*net.UDPConn)}, nil
+	case "unix", "unixgram", "unixpacket":
+		return &UnixConn{uc: c.(*net.UnixConn)}, nil
+	}
+	return c, nil
+}
+
+// DialContext dials addr, racing IPv4 and IPv6 candidates per RFC 6555
+// (Happy Eyeballs) when network is a flavor of "tcp" and the host
+// resolves to more than one address. Attempts are staggered by
+// FallbackDelay (default 300ms); the first to succeed wins and the
+// rest are canceled.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		c, err := d.netDialer().DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return wrapConn(network, c)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := d.Resolver.lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ordered := interleave(addrs)
+	if len(ordered) == 0 {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("no addresses found for " + host)}
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(ordered))
+	var wg sync.WaitGroup
+	for i, ia := range ordered {
+		i, ia := i, ia
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i > 0 {
+				timer := time.NewTimer(time.Duration(i) * d.fallbackDelay())
+				defer timer.Stop()
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+			}
+			c, err := d.netDialer().DialContext(ctx, network, net.JoinHostPort(ia.IP.String(), port))
+			select {
+			case results <- result{c, err}:
+			case <-ctx.Done():
+				if c != nil {
+					c.Close()
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Drain every result, even after a winner is picked: canceling ctx
+	// only asks the other goroutines to stop, it doesn't guarantee they
+	// see ctx.Done() before their DialContext has already returned a
+	// live conn, so anything that shows up afterward still needs to be
+	// closed here rather than leaked.
+	var winner net.Conn
+	var lastErr error
+	for r := range results {
+		if r.err != nil {
+			lastErr = r.err
+			continue
+		}
+		if winner == nil {
+			winner = r.conn
+			cancel()
+		} else {
+			r.conn.Close()
+		}
+	}
+	if winner != nil {
+		return wrapConn(network, winner)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("dial: all connection attempts failed")
+	}
+	return nil, lastErr
+}
+
+// DialContext dials addr using a zero-value Dialer.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
 // TCPConn ...
 type TCPConn struct {
 	tc *net.TCPConn
@@ -98,6 +300,300 @@ func (c *TCPConn) SyscallConn() (syscall.RawConn, error) {
 	return c.tc.SyscallConn()
 }
 
+// UDPConn ...
+type UDPConn struct {
+	uc *net.UDPConn
+}
+
+func (c *UDPConn) Read(b []byte) (ln int, err error) {
+	return c.uc.Read(b)
+}
+func (c *UDPConn) Write(b []byte) (ln int, err error) {
+	return c.uc.Write(b)
+}
+func (c *UDPConn) Close() error {
+	return c.uc.Close()
+}
+func (c *UDPConn) LocalAddr() net.Addr {
+	return c.uc.LocalAddr()
+}
+func (c *UDPConn) RemoteAddr() net.Addr {
+	return c.uc.RemoteAddr()
+}
+func (c *UDPConn) SetDeadline(t time.Time) error {
+	return c.uc.SetDeadline(t)
+}
+func (c *UDPConn) SetReadDeadline(t time.Time) error {
+	return c.uc.SetReadDeadline(t)
+}
+func (c *UDPConn) SetWriteDeadline(t time.Time) error {
+	return c.uc.SetWriteDeadline(t)
+}
+func (c *UDPConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	return c.uc.ReadFrom(b)
+}
+func (c *UDPConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	return c.uc.WriteTo(b, addr)
+}
+func (c *UDPConn) ReadFromUDP(b []byte) (n int, addr *net.UDPAddr, err error) {
+	return c.uc.ReadFromUDP(b)
+}
+func (c *UDPConn) WriteToUDP(b []byte, addr *net.UDPAddr) (n int, err error) {
+	return c.uc.WriteToUDP(b, addr)
+}
+func (c *UDPConn) ReadMsgUDP(b, oob []byte) (n, oobn, flags int, addr *net.UDPAddr, err error) {
+	return c.uc.ReadMsgUDP(b, oob)
+}
+func (c *UDPConn) WriteMsgUDP(b, oob []byte, addr *net.UDPAddr) (n, oobn int, err error) {
+	return c.uc.WriteMsgUDP(b, oob, addr)
+}
+func (c *UDPConn) SetReadBuffer(bytes int) error {
+	return c.uc.SetReadBuffer(bytes)
+}
+func (c *UDPConn) SetWriteBuffer(bytes int) error {
+	return c.uc.SetWriteBuffer(bytes)
+}
+func (c *UDPConn) File() (f *os.File, err error) {
+	return c.uc.File()
+}
+func (c *UDPConn) SyscallConn() (syscall.RawConn, error) {
+	return c.uc.SyscallConn()
+}
+
+func DialUDP(network string, laddr, raddr *net.UDPAddr) (*UDPConn, error) {
+	uc, err := net.DialUDP(network, laddr, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPConn{uc: uc}, nil
+}
+
+// ListenMulticastUDP joins gaddr on ifi (the system-chosen interface if nil) and
+// listens for datagrams sent to it, the real counterpart of the
+// IP_ADD_MEMBERSHIP/IPV6_JOIN_GROUP no-ops the js/wasm fake network
+// records for the same sockopts.
+func ListenMulticastUDP(network string, ifi *net.Interface, gaddr *net.UDPAddr) (*UDPConn, error) {
+	uc, err := net.ListenMulticastUDP(network, ifi, gaddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPConn{uc: uc}, nil
+}
+
+// JoinGroup makes c a member of the multicast group gaddr on ifi (the
+// system-chosen interface if nil), issuing a real IP_ADD_MEMBERSHIP/IPV6_JOIN_GROUP
+// setsockopt.
+func (c *UDPConn) JoinGroup(ifi *net.Interface, gaddr net.Addr) error {
+	return c.setMembership(ifi, gaddr, true)
+}
+
+// LeaveGroup removes c from the multicast group gaddr on ifi, issuing a
+// real IP_DROP_MEMBERSHIP/IPV6_LEAVE_GROUP setsockopt.
+func (c *UDPConn) LeaveGroup(ifi *net.Interface, gaddr net.Addr) error {
+	return c.setMembership(ifi, gaddr, false)
+}
+
+func (c *UDPConn) setMembership(ifi *net.Interface, gaddr net.Addr, join bool) error {
+	ip := multicastAddrIP(gaddr)
+	if ip == nil {
+		return &net.AddrError{Err: "expected a multicast address", Addr: gaddr.String()}
+	}
+	rc, err := c.uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var opErr error
+	if ip4 := ip.To4(); ip4 != nil {
+		mreq := &syscall.IPMreq{}
+		copy(mreq.Multiaddr[:], ip4)
+		if ifi != nil {
+			if addr := interfaceIPv4Addr(ifi); addr != nil {
+				copy(mreq.Interface[:], addr)
+			}
+		}
+		opt := syscall.IP_ADD_MEMBERSHIP
+		if !join {
+			opt = syscall.IP_DROP_MEMBERSHIP
+		}
+		err = rc.Control(func(fd uintptr) {
+			opErr = syscall.SetsockoptIPMreq(int(fd), syscall.IPPROTO_IP, opt, mreq)
+		})
+	} else {
+		mreq := &syscall.IPv6Mreq{}
+		copy(mreq.Multiaddr[:], ip.To16())
+		if ifi != nil {
+			mreq.Interface = uint32(ifi.Index)
+		}
+		opt := syscall.IPV6_JOIN_GROUP
+		if !join {
+			opt = syscall.IPV6_LEAVE_GROUP
+		}
+		err = rc.Control(func(fd uintptr) {
+			opErr = syscall.SetsockoptIPv6Mreq(int(fd), syscall.IPPROTO_IPV6, opt, mreq)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return opErr
+}
+
+func multicastAddrIP(a net.Addr) net.IP {
+	switch a := a.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+func interfaceIPv4Addr(ifi *net.Interface) net.IP {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		var ip net.IP
+		switch a := a.(type) {
+		case *net.IPNet:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	return nil
+}
+
+func ListenUDP(network string, laddr *net.UDPAddr) (*UDPConn, error) {
+	uc, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPConn{uc: uc}, nil
+}
+
+func ListenPacket(network, addr string) (net.PacketConn, error) {
+	return net.ListenPacket(network, addr)
+}
+
+// UnixConn ...
+type UnixConn struct {
+	uc *net.UnixConn
+}
+
+func (c *UnixConn) Read(b []byte) (ln int, err error) {
+	return c.uc.Read(b)
+}
+func (c *UnixConn) Write(b []byte) (ln int, err error) {
+	return c.uc.Write(b)
+}
+func (c *UnixConn) Close() error {
+	return c.uc.Close()
+}
+func (c *UnixConn) LocalAddr() net.Addr {
+	return c.uc.LocalAddr()
+}
+func (c *UnixConn) RemoteAddr() net.Addr {
+	return c.uc.RemoteAddr()
+}
+func (c *UnixConn) SetDeadline(t time.Time) error {
+	return c.uc.SetDeadline(t)
+}
+func (c *UnixConn) SetReadDeadline(t time.Time) error {
+	return c.uc.SetReadDeadline(t)
+}
+func (c *UnixConn) SetWriteDeadline(t time.Time) error {
+	return c.uc.SetWriteDeadline(t)
+}
+func (c *UnixConn) ReadFromUnix(b []byte) (n int, addr *net.UnixAddr, err error) {
+	return c.uc.ReadFromUnix(b)
+}
+func (c *UnixConn) WriteToUnix(b []byte, addr *net.UnixAddr) (n int, err error) {
+	return c.uc.WriteToUnix(b, addr)
+}
+func (c *UnixConn) ReadMsgUnix(b, oob []byte) (n, oobn, flags int, addr *net.UnixAddr, err error) {
+	return c.uc.ReadMsgUnix(b, oob)
+}
+func (c *UnixConn) WriteMsgUnix(b, oob []byte, addr *net.UnixAddr) (n, oobn int, err error) {
+	return c.uc.WriteMsgUnix(b, oob, addr)
+}
+func (c *UnixConn) CloseRead() error {
+	return c.uc.CloseRead()
+}
+func (c *UnixConn) CloseWrite() error {
+	return c.uc.CloseWrite()
+}
+func (c *UnixConn) SetReadBuffer(bytes int) error {
+	return c.uc.SetReadBuffer(bytes)
+}
+func (c *UnixConn) SetWriteBuffer(bytes int) error {
+	return c.uc.SetWriteBuffer(bytes)
+}
+func (c *UnixConn) File() (f *os.File, err error) {
+	return c.uc.File()
+}
+func (c *UnixConn) SyscallConn() (syscall.RawConn, error) {
+	return c.uc.SyscallConn()
+}
+
+func DialUnix(network string, laddr, raddr *net.UnixAddr) (*UnixConn, error) {
+	uc, err := net.DialUnix(network, laddr, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UnixConn{uc: uc}, nil
+}
+
+// UnixListener ...
+type UnixListener struct {
+	ul *net.UnixListener
+}
+
+func (l *UnixListener) Close() error {
+	return l.ul.Close()
+}
+
+func (l *UnixListener) Addr() net.Addr {
+	return l.ul.Addr()
+}
+
+func (l *UnixListener) SetDeadline(t time.Time) error {
+	return l.ul.SetDeadline(t)
+}
+
+func (l *UnixListener) Accept() (net.Conn, error) {
+	uc, err := l.ul.Accept()
+	if err != nil {
+		return uc, err
+	}
+	switch uc := uc.(type) {
+	case *net.UnixConn:
+		return &UnixConn{uc: uc}, err
+	}
+	return nil, errors.New("UnixListener accept didn't return a unix conn")
+}
+
+func (l *UnixListener) AcceptUnix() (*UnixConn, error) {
+	uc, err := l.ul.AcceptUnix()
+	if err != nil {
+		return nil, err
+	}
+	return &UnixConn{uc: uc}, err
+}
+
+func ListenUnix(network string, laddr *net.UnixAddr) (*UnixListener, error) {
+	l, err := net.ListenUnix(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UnixListener{ul: l}, nil
+}
+
 // TCPListener ...
 type TCPListener struct {
 	tl *net.TCPListener
@@ -146,3 +642,11 @@ func ListenTCP(network string, laddr *net.TCPAddr) (*TCPListener, error) {
 func Listen(network, addr string) (net.Listener, error) {
 	return net.Listen(network, addr)
 }
+
+func ListenUnixgram(network string, laddr *net.UnixAddr) (*UnixConn, error) {
+	uc, err := net.ListenUnixgram(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UnixConn{uc: uc}, nil
+}
@@ -0,0 +1,133 @@
+// +build !js !wasm
+
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestInterleave(t *testing.T) {
+	addrs := []net.IPAddr{
+		{IP: net.ParseIP("192.0.2.1")},
+		{IP: net.ParseIP("192.0.2.2")},
+		{IP: net.ParseIP("2001:db8::1")},
+	}
+	got := interleave(addrs)
+	want := []string{"2001:db8::1", "192.0.2.1", "192.0.2.2"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d addrs, want %d", len(got), len(want))
+	}
+	for i, a := range got {
+		if a.IP.String() != want[i] {
+			t.Fatalf("addr[%d] = %s, want %s", i, a.IP.String(), want[i])
+		}
+	}
+}
+
+// TestDialContextClosesLosingConnections races DialContext against two
+// addresses that both accept, and checks the loser's established
+// connection gets closed rather than abandoned (the fd/socket leak
+// fixed alongside this test). Whether both candidates complete before
+// the winner cancels the rest is itself a race (the fallback goroutine
+// can instead see ctx.Done() before ever dialing), so this retries
+// until it observes both sides connecting, same as the leak's own
+// reproduction required many trials.
+func TestDialContextClosesLosingConnections(t *testing.T) {
+	for attempt := 0; attempt < 50; attempt++ {
+		raced, err := dialContextRaceAttempt(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raced {
+			return
+		}
+	}
+	t.Skip("both candidates never completed before cancellation within the retry budget")
+}
+
+// dialContextRaceAttempt runs one DialContext race between 127.0.0.1
+// and 127.0.0.2 on the same port. It reports raced=true only if both
+// sides actually accepted a connection, in which case it also asserts
+// that exactly one of them was closed by the client (the loser).
+func dialContextRaceAttempt(t *testing.T) (raced bool, err error) {
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return false, err
+	}
+	_, port, _ := net.SplitHostPort(probe.Addr().String())
+	probe.Close()
+
+	la, err := net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		return false, nil
+	}
+	defer la.Close()
+	lb, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		t.Skipf("127.0.0.2 unavailable in this environment: %v", err)
+	}
+	defer lb.Close()
+
+	accepted := make(chan net.Conn, 2)
+	accept := func(l net.Listener) {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}
+	go accept(la)
+	go accept(lb)
+
+	d := &Dialer{
+		FallbackDelay: time.Nanosecond,
+		Resolver: &Resolver{
+			LookupIPAddr: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+				return []net.IPAddr{
+					{IP: net.ParseIP("127.0.0.1")},
+					{IP: net.ParseIP("127.0.0.2")},
+				}, nil
+			},
+		},
+	}
+
+	c, dialErr := d.DialContext(context.Background(), "tcp", "dual.example:"+port)
+	if dialErr != nil {
+		return false, dialErr
+	}
+	defer c.Close()
+
+	var servers []net.Conn
+	for len(servers) < 2 {
+		select {
+		case sc := <-accepted:
+			servers = append(servers, sc)
+		case <-time.After(200 * time.Millisecond):
+			for _, sc := range servers {
+				sc.Close()
+			}
+			return false, nil
+		}
+	}
+	defer servers[0].Close()
+	defer servers[1].Close()
+
+	// The winner's connection is left open by design, so a read on it
+	// times out rather than erroring; only io.EOF means the client
+	// actually closed its end.
+	closedCount := 0
+	for _, sc := range servers {
+		sc.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		buf := make([]byte, 1)
+		if _, rerr := sc.Read(buf); rerr == io.EOF {
+			closedCount++
+		}
+	}
+	if closedCount != 1 {
+		t.Fatalf("expected exactly 1 losing connection closed by the client, got %d", closedCount)
+	}
+	return true, nil
+}